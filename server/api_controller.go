@@ -0,0 +1,313 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/runatlantis/atlantis/server/events"
+	"github.com/runatlantis/atlantis/server/events/locking"
+	"github.com/runatlantis/atlantis/server/events/models"
+	"github.com/runatlantis/atlantis/server/events/vcs"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// APIController handles requests to the versioned JSON API under /api/v1.
+// It exposes the same lock and command functionality available through the
+// HTML UI and PR comments so that third-party dashboards and CI systems can
+// drive Atlantis programmatically.
+type APIController struct {
+	AtlantisVersion string
+	Locker          locking.Locker
+	Logger          log.Logger
+	VCSClient       vcs.ClientProxy
+	CommandRunner   events.CommandRunner
+	// Authorizer gates plan/apply/unlock the same way it does on the
+	// PR-comment and locks-UI paths. A nil Authorizer allows everything.
+	Authorizer events.Authorizer
+}
+
+// LockResponse is the stable JSON representation of a models.ProjectLock.
+type LockResponse struct {
+	ID        string `json:"id"`
+	Repo      string `json:"repo"`
+	Workspace string `json:"workspace"`
+	Path      string `json:"path"`
+	PullNum   int    `json:"pullNum"`
+	Author    string `json:"author"`
+	Time      string `json:"time"`
+}
+
+// CommandResponse is returned by the plan/apply endpoints to acknowledge
+// that the command was triggered. The actual plan/apply output is still
+// posted back to the pull request as a comment.
+type CommandResponse struct {
+	Repo    string `json:"repo"`
+	PullNum int    `json:"pullNum"`
+	Command string `json:"command"`
+	Status  string `json:"status"`
+}
+
+// bulkDeleteRequest is the body of POST /api/v1/locks/bulk-delete.
+type bulkDeleteRequest struct {
+	Repo      string `json:"repo"`
+	Workspace string `json:"workspace"`
+	PullNum   int    `json:"pullNum"`
+}
+
+// ListLocks is the GET /api/v1/locks route. It supports filtering by repo,
+// workspace, pull request number, and author via query parameters.
+func (a *APIController) ListLocks(w http.ResponseWriter, r *http.Request) {
+	locks, err := a.Locker.List()
+	if err != nil {
+		a.respondErr(w, http.StatusInternalServerError, "listing locks: %s", err)
+		return
+	}
+
+	repoFilter := r.URL.Query().Get("repo")
+	workspaceFilter := r.URL.Query().Get("workspace")
+	authorFilter := r.URL.Query().Get("author")
+	pullFilter := r.URL.Query().Get("pull")
+
+	var resp []LockResponse
+	for id, lock := range locks {
+		if repoFilter != "" && lock.Project.RepoFullName != repoFilter {
+			continue
+		}
+		if workspaceFilter != "" && lock.Workspace != workspaceFilter {
+			continue
+		}
+		if authorFilter != "" && lock.Pull.Author != authorFilter {
+			continue
+		}
+		if pullFilter != "" && strconv.Itoa(lock.Pull.Num) != pullFilter {
+			continue
+		}
+		resp = append(resp, toLockResponse(id, lock))
+	}
+	a.respondJSON(w, http.StatusOK, resp)
+}
+
+// GetLock is the GET /api/v1/locks/{id} route.
+func (a *APIController) GetLock(w http.ResponseWriter, r *http.Request) {
+	id, err := decodeLockID(r)
+	if err != nil {
+		a.respondErr(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+	lock, err := a.Locker.GetLock(id)
+	if err != nil {
+		a.respondErr(w, http.StatusInternalServerError, "getting lock: %s", err)
+		return
+	}
+	if lock == nil {
+		a.respondErr(w, http.StatusNotFound, "no lock found at id %q", id)
+		return
+	}
+	a.respondJSON(w, http.StatusOK, toLockResponse(id, *lock))
+}
+
+// DeleteLock is the DELETE /api/v1/locks/{id} route.
+func (a *APIController) DeleteLock(w http.ResponseWriter, r *http.Request) {
+	id, err := decodeLockID(r)
+	if err != nil {
+		a.respondErr(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+	if a.Authorizer != nil {
+		existing, err := a.Locker.GetLock(id)
+		if err != nil {
+			a.respondErr(w, http.StatusInternalServerError, "getting lock: %s", err)
+			return
+		}
+		if existing == nil {
+			a.respondErr(w, http.StatusNotFound, "no lock found at id %q", id)
+			return
+		}
+		if ok, reason := a.Authorizer.IsAuthorized(existing.Project.RepoFullName, requestingUser(r), events.ActionUnlock, ""); !ok {
+			a.commentRejection(existing.Pull.BaseRepo, existing.Pull.Num, reason, fmt.Sprintf("unlock dir: `%s` workspace: `%s`", existing.Project.Path, existing.Workspace))
+			a.respondErr(w, http.StatusForbidden, "unlock rejected: %s", reason)
+			return
+		}
+	}
+
+	lock, err := a.Locker.Unlock(id)
+	if err != nil {
+		a.respondErr(w, http.StatusInternalServerError, "deleting lock: %s", err)
+		return
+	}
+	if lock == nil {
+		a.respondErr(w, http.StatusNotFound, "no lock found at id %q", id)
+		return
+	}
+	a.respondJSON(w, http.StatusOK, toLockResponse(id, *lock))
+}
+
+// BulkDeleteLocks is the POST /api/v1/locks/bulk-delete route. It deletes
+// every lock matching the given repo, pull request number, and/or
+// workspace.
+func (a *APIController) BulkDeleteLocks(w http.ResponseWriter, r *http.Request) {
+	var body bulkDeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		a.respondErr(w, http.StatusBadRequest, "invalid request body: %s", err)
+		return
+	}
+	if body.Repo == "" && body.PullNum == 0 && body.Workspace == "" {
+		a.respondErr(w, http.StatusBadRequest, "must specify at least one of repo, pullNum, or workspace")
+		return
+	}
+
+	locks, err := a.Locker.List()
+	if err != nil {
+		a.respondErr(w, http.StatusInternalServerError, "listing locks: %s", err)
+		return
+	}
+
+	requestedBy := requestingUser(r)
+	var deleted []LockResponse
+	for id, lock := range locks {
+		if body.Repo != "" && lock.Project.RepoFullName != body.Repo {
+			continue
+		}
+		if body.Workspace != "" && lock.Workspace != body.Workspace {
+			continue
+		}
+		if body.PullNum != 0 && lock.Pull.Num != body.PullNum {
+			continue
+		}
+		if a.Authorizer != nil {
+			if ok, reason := a.Authorizer.IsAuthorized(lock.Project.RepoFullName, requestedBy, events.ActionUnlock, ""); !ok {
+				a.Logger.Info("unlock rejected by authorizer during bulk-delete", "user", requestedBy.Username, "id", id, "reason", reason)
+				a.commentRejection(lock.Pull.BaseRepo, lock.Pull.Num, reason, fmt.Sprintf("unlock dir: `%s` workspace: `%s`", lock.Project.Path, lock.Workspace))
+				continue
+			}
+		}
+		if _, err := a.Locker.Unlock(id); err != nil {
+			a.Logger.Warn("unable to delete lock during bulk-delete", "id", id, "err", err)
+			continue
+		}
+		deleted = append(deleted, toLockResponse(id, lock))
+	}
+	a.respondJSON(w, http.StatusOK, deleted)
+}
+
+// Plan is the POST /api/v1/repos/{owner}/{repo}/pulls/{num}/plan route.
+func (a *APIController) Plan(w http.ResponseWriter, r *http.Request) {
+	a.runCommand(w, r, events.Plan)
+}
+
+// Apply is the POST /api/v1/repos/{owner}/{repo}/pulls/{num}/apply route.
+func (a *APIController) Apply(w http.ResponseWriter, r *http.Request) {
+	a.runCommand(w, r, events.Apply)
+}
+
+func (a *APIController) runCommand(w http.ResponseWriter, r *http.Request, name events.CommandName) {
+	vars := mux.Vars(r)
+	owner, repoName, numRaw := vars["owner"], vars["repo"], vars["num"]
+	pullNum, err := strconv.Atoi(numRaw)
+	if err != nil {
+		a.respondErr(w, http.StatusBadRequest, "invalid pull request number %q", numRaw)
+		return
+	}
+
+	baseRepo := models.Repo{
+		FullName: fmt.Sprintf("%s/%s", owner, repoName),
+		Owner:    owner,
+		Name:     repoName,
+	}
+	user := requestingUser(r)
+	if a.Authorizer != nil {
+		action := events.ActionPlan
+		if name == events.Apply {
+			action = events.ActionApply
+		}
+		if ok, reason := a.Authorizer.IsAuthorized(baseRepo.FullName, user, action, ""); !ok {
+			a.commentRejection(baseRepo, pullNum, reason, fmt.Sprintf("`%s`", strings.ToLower(name.String())))
+			a.respondErr(w, http.StatusForbidden, "%s rejected: %s", strings.ToLower(name.String()), reason)
+			return
+		}
+	}
+	cmd := &events.CommentCommand{Name: name}
+
+	// RunCommentCommand posts its output back to the pull request as a
+	// comment, the same as it does when triggered via PR comment, so we
+	// only need to acknowledge here that the command was accepted.
+	a.CommandRunner.RunCommentCommand(a.Logger, baseRepo, nil, user, pullNum, cmd)
+	a.respondJSON(w, http.StatusOK, CommandResponse{
+		Repo:    baseRepo.FullName,
+		PullNum: pullNum,
+		Command: strings.ToLower(name.String()),
+		Status:  "triggered",
+	})
+}
+
+// commentRejection posts a comment on the pull request explaining why an
+// API request was denied by the Authorizer, as validateCtxAndComment and
+// LocksController.DeleteLock do for their respective paths. Its wording
+// ("Atlantis rejected <what>: <reason>") differs from theirs.
+func (a *APIController) commentRejection(baseRepo models.Repo, pullNum int, reason string, what string) {
+	if baseRepo == (models.Repo{}) {
+		return
+	}
+	comment := fmt.Sprintf("Atlantis rejected %s: %s", what, reason)
+	if err := a.VCSClient.CreateComment(baseRepo, pullNum, comment); err != nil {
+		a.Logger.Warn("unable to comment on pull request about rejected command", "err", err)
+	}
+}
+
+// requestingUser identifies the caller of the API for authorization and
+// audit purposes. The API doesn't do VCS OAuth on behalf of callers, so
+// trusted dashboards are expected to set this header to the VCS username
+// they're acting on behalf of.
+func requestingUser(r *http.Request) models.User {
+	return models.User{Username: r.Header.Get("X-Atlantis-User")}
+}
+
+// decodeLockID extracts and unescapes the lock id from the request path.
+// Lock ids embed the repo's full name (e.g. "owner/repo/...") so the route
+// registers {id} as a wildcard (see api_routes.go); this mirrors
+// LocksController, which does the same unescaping for the same reason.
+func decodeLockID(r *http.Request) (string, error) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok || id == "" {
+		return "", errors.New("no lock id in request")
+	}
+	idUnencoded, err := url.PathUnescape(id)
+	if err != nil {
+		return "", errors.Errorf("invalid lock id %q: %s", id, err)
+	}
+	return idUnencoded, nil
+}
+
+func toLockResponse(id string, lock models.ProjectLock) LockResponse {
+	return LockResponse{
+		ID:        id,
+		Repo:      lock.Project.RepoFullName,
+		Workspace: lock.Workspace,
+		Path:      lock.Project.Path,
+		PullNum:   lock.Pull.Num,
+		Author:    lock.Pull.Author,
+		Time:      lock.Time.String(),
+	}
+}
+
+func (a *APIController) respondJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		a.Logger.Error("unable to encode API response", "err", err)
+	}
+}
+
+func (a *APIController) respondErr(w http.ResponseWriter, code int, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	a.Logger.Warn(msg)
+	a.respondJSON(w, code, struct {
+		Error string `json:"error"`
+	}{Error: msg})
+}
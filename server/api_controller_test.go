@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// requestWithLockID builds a request with id set as a mux var the way the
+// router would after matching the {id:.*} wildcard route.
+func requestWithLockID(id string) *http.Request {
+	r := httptest.NewRequest("GET", "/api/v1/locks/"+id, nil)
+	return mux.SetURLVars(r, map[string]string{"id": id})
+}
+
+func TestDecodeLockID_UnescapesRepoSlashes(t *testing.T) {
+	// Real lock ids embed the repo's full name, e.g.
+	// "owner/repo/default/workspace", and may be percent-encoded by the
+	// caller.
+	r := requestWithLockID("owner%2Frepo%2Fdefault%2Fworkspace")
+	id, err := decodeLockID(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "owner/repo/default/workspace", id)
+}
+
+func TestDecodeLockID_MissingID(t *testing.T) {
+	r := mux.SetURLVars(httptest.NewRequest("GET", "/api/v1/locks/", nil), map[string]string{})
+	_, err := decodeLockID(r)
+	assert.Error(t, err)
+}
@@ -0,0 +1,48 @@
+package server
+
+import "github.com/gorilla/mux"
+
+// Route names for the versioned JSON API. Naming these (rather than
+// inlining path strings at every call site) lets other handlers generate
+// links to these routes, the same convention used for the HTML routes
+// registered for LocksController.
+const (
+	APIListLocksRouteName  = "api-list-locks"
+	APIGetLockRouteName    = "api-get-lock"
+	APIDeleteLockRouteName = "api-delete-lock"
+	APIBulkDeleteRouteName = "api-bulk-delete-locks"
+	APIPlanRouteName       = "api-plan"
+	APIApplyRouteName      = "api-apply"
+)
+
+// RegisterAPIRoutes adds the /api/v1 routes served by APIController to
+// router, protecting all of them with auth. Call this alongside the
+// existing HTML route registration when constructing the server's router.
+func RegisterAPIRoutes(router *mux.Router, api *APIController, auth *APITokenAuth) {
+	sub := router.PathPrefix("/api/v1").Subrouter()
+	sub.Use(auth.Middleware)
+
+	// Lock ids embed the repo's full name ("owner/repo/...") so {id} must be
+	// a wildcard, the same as LocksController's lock routes.
+	sub.HandleFunc("/locks", api.ListLocks).Methods("GET").Name(APIListLocksRouteName)
+	sub.HandleFunc("/locks/{id:.*}", api.GetLock).Methods("GET").Name(APIGetLockRouteName)
+	sub.HandleFunc("/locks/{id:.*}", api.DeleteLock).Methods("DELETE").Name(APIDeleteLockRouteName)
+	sub.HandleFunc("/locks/bulk-delete", api.BulkDeleteLocks).Methods("POST").Name(APIBulkDeleteRouteName)
+	sub.HandleFunc("/repos/{owner}/{repo}/pulls/{num}/plan", api.Plan).Methods("POST").Name(APIPlanRouteName)
+	sub.HandleFunc("/repos/{owner}/{repo}/pulls/{num}/apply", api.Apply).Methods("POST").Name(APIApplyRouteName)
+}
+
+// Route names for the job queue UI/API.
+const (
+	JobsListRouteName = "jobs-list"
+	JobGetRouteName   = "job-detail"
+	JobLogsRouteName  = "job-logs"
+)
+
+// RegisterJobsRoutes adds the job queue routes served by JobsController to
+// router.
+func RegisterJobsRoutes(router *mux.Router, jobs *JobsController) {
+	router.HandleFunc("/jobs", jobs.ListJobs).Methods("GET").Name(JobsListRouteName)
+	router.HandleFunc("/jobs/{id}", jobs.GetJob).Methods("GET").Name(JobGetRouteName)
+	router.HandleFunc("/jobs/{id}/logs", jobs.StreamJobLogs).Methods("GET").Name(JobLogsRouteName)
+}
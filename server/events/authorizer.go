@@ -0,0 +1,165 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/runatlantis/atlantis/server/events/models"
+)
+
+//go:generate pegomock generate -m --use-experimental-model-gen --package mocks -o mocks/mock_authorizer.go Authorizer
+
+// Action is an operation gated by an Authorizer. It's kept separate from
+// CommandName because Unlock isn't a command a user can ask Atlantis to run
+// via a comment, it's triggered from the locks UI/API as well.
+type Action string
+
+const (
+	// ActionPlan gates running `atlantis plan`.
+	ActionPlan Action = "plan"
+	// ActionApply gates running `atlantis apply`.
+	ActionApply Action = "apply"
+	// ActionUnlock gates deleting a lock, whether from the UI or the API.
+	ActionUnlock Action = "unlock"
+)
+
+// Authorizer decides whether a user may perform action against a repo, and
+// optionally a specific directory within it (for per-directory ownership
+// rules). It's consulted on both the PR-comment path and the JSON API path
+// so the two can't be used to bypass each other.
+type Authorizer interface {
+	// IsAuthorized returns whether user may perform action in repoFullName.
+	// repoRelDir is the repo-relative directory the action applies to and
+	// may be empty when it isn't yet known (e.g. before BuildPlanCommand has
+	// run). When ok is false, reason explains why, suitable for posting back
+	// to the pull request.
+	IsAuthorized(repoFullName string, user models.User, action Action, repoRelDir string) (ok bool, reason string)
+}
+
+// TeamResolver looks up which VCS teams a user belongs to, so Allowlist and
+// DirectoryOwners entries can name a team instead of enumerating every
+// member's username. It's the seam a real GitHub/GitLab teams API client
+// plugs into; UserAuthorizer itself performs no I/O.
+type TeamResolver interface {
+	// Teams returns the names of every team repoFullName's host grants user
+	// membership in. An error is treated the same as "no teams" so a VCS
+	// outage fails closed (denies team-gated access) rather than open.
+	Teams(repoFullName string, user models.User) ([]string, error)
+}
+
+// UserAuthorizer is the default Authorizer. It's populated from server
+// config (global allow/block lists) and from a repo's atlantis.yaml
+// (per-directory owners), and performs no I/O of its own beyond the
+// optional Teams resolver.
+type UserAuthorizer struct {
+	// Blocklist is a set of usernames whose comments are ignored entirely,
+	// regardless of which action they're attempting.
+	Blocklist []string
+	// Allowlist maps an action to the usernames or team names allowed to
+	// perform it. An empty or missing entry means the action is allowed for
+	// everyone (subject to Blocklist and DirectoryOwners).
+	Allowlist map[Action][]string
+	// DirectoryOwners maps a repo-relative directory prefix (e.g.
+	// "infra/prod") to the usernames or team names allowed to apply changes
+	// under it. Directories with no entry have no ownership restriction.
+	DirectoryOwners map[string][]string
+	// Teams resolves team membership for entries in Allowlist/DirectoryOwners
+	// that name a team rather than a username. A nil Teams means every entry
+	// is matched against the username only, so a team name in either list
+	// matches only a user whose username is that same string.
+	Teams TeamResolver
+}
+
+// UserAuthorizerConfig holds the allow/block/ownership rules loaded from
+// server config flags and from a repo's atlantis.yaml `allowed_users` /
+// `allowed_teams` / `owners` blocks, for NewUserAuthorizer to build a
+// UserAuthorizer from. An empty config yields a UserAuthorizer that allows
+// every user every action.
+type UserAuthorizerConfig struct {
+	Blocklist       []string
+	Allowlist       map[Action][]string
+	DirectoryOwners map[string][]string
+	// Teams is optional; see UserAuthorizer.Teams.
+	Teams TeamResolver
+}
+
+// NewUserAuthorizer constructs a UserAuthorizer from cfg. Callers are
+// expected to merge server-wide config with any repo-level atlantis.yaml
+// overrides into cfg before calling this.
+func NewUserAuthorizer(cfg UserAuthorizerConfig) *UserAuthorizer {
+	a := &UserAuthorizer{
+		Blocklist:       cfg.Blocklist,
+		Allowlist:       cfg.Allowlist,
+		DirectoryOwners: cfg.DirectoryOwners,
+		Teams:           cfg.Teams,
+	}
+	if a.Allowlist == nil {
+		a.Allowlist = make(map[Action][]string)
+	}
+	if a.DirectoryOwners == nil {
+		a.DirectoryOwners = make(map[string][]string)
+	}
+	return a
+}
+
+func (a *UserAuthorizer) IsAuthorized(repoFullName string, user models.User, action Action, repoRelDir string) (bool, string) {
+	if contains(a.Blocklist, user.Username) {
+		return false, fmt.Sprintf("user %q is blocklisted from running Atlantis commands", user.Username)
+	}
+
+	if allowed, ok := a.Allowlist[action]; ok && len(allowed) > 0 && !a.isAllowed(repoFullName, user, allowed) {
+		return false, fmt.Sprintf("user %q is not allowed to run %q", user.Username, action)
+	}
+
+	if action == ActionApply && repoRelDir != "" {
+		for dir, owners := range a.DirectoryOwners {
+			if !isUnderDir(repoRelDir, dir) {
+				continue
+			}
+			if !a.isAllowed(repoFullName, user, owners) {
+				return false, fmt.Sprintf("user %q is not an owner of %q and can't apply changes there", user.Username, dir)
+			}
+		}
+	}
+
+	return true, ""
+}
+
+// isAllowed returns whether user matches one of list's entries, either
+// directly by username or, when a.Teams is configured, by membership in a
+// team named in list.
+func (a *UserAuthorizer) isAllowed(repoFullName string, user models.User, list []string) bool {
+	if contains(list, user.Username) {
+		return true
+	}
+	if a.Teams == nil {
+		return false
+	}
+	teams, err := a.Teams.Teams(repoFullName, user)
+	if err != nil {
+		return false
+	}
+	for _, team := range teams {
+		if contains(list, team) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnderDir returns true if repoRelDir is dir or a subdirectory of it.
+func isUnderDir(repoRelDir string, dir string) bool {
+	if repoRelDir == dir {
+		return true
+	}
+	return strings.HasPrefix(repoRelDir, dir+"/")
+}
@@ -0,0 +1,113 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/runatlantis/atlantis/server/events/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserAuthorizer_Blocklist(t *testing.T) {
+	a := NewUserAuthorizer(UserAuthorizerConfig{Blocklist: []string{"evil-bot"}})
+	ok, reason := a.IsAuthorized("owner/repo", models.User{Username: "evil-bot"}, ActionPlan, "")
+	assert.False(t, ok)
+	assert.Contains(t, reason, "blocklisted")
+
+	ok, _ = a.IsAuthorized("owner/repo", models.User{Username: "good-user"}, ActionPlan, "")
+	assert.True(t, ok)
+}
+
+func TestUserAuthorizer_Allowlist(t *testing.T) {
+	a := NewUserAuthorizer(UserAuthorizerConfig{
+		Allowlist: map[Action][]string{
+			ActionApply: {"releng"},
+		},
+	})
+
+	ok, _ := a.IsAuthorized("owner/repo", models.User{Username: "anyone"}, ActionPlan, "")
+	assert.True(t, ok, "plan has no allowlist entry so everyone is allowed")
+
+	ok, reason := a.IsAuthorized("owner/repo", models.User{Username: "anyone"}, ActionApply, "")
+	assert.False(t, ok)
+	assert.Contains(t, reason, "not allowed to run")
+
+	ok, _ = a.IsAuthorized("owner/repo", models.User{Username: "releng"}, ActionApply, "")
+	assert.True(t, ok)
+}
+
+func TestUserAuthorizer_DirectoryOwners(t *testing.T) {
+	a := NewUserAuthorizer(UserAuthorizerConfig{
+		DirectoryOwners: map[string][]string{
+			"infra/prod": {"sre-team"},
+		},
+	})
+
+	ok, _ := a.IsAuthorized("owner/repo", models.User{Username: "anyone"}, ActionApply, "infra/staging")
+	assert.True(t, ok, "directories without an owners entry aren't restricted")
+
+	ok, reason := a.IsAuthorized("owner/repo", models.User{Username: "anyone"}, ActionApply, "infra/prod/networking")
+	assert.False(t, ok, "subdirectories inherit their parent's ownership rule")
+	assert.Contains(t, reason, "not an owner")
+
+	ok, _ = a.IsAuthorized("owner/repo", models.User{Username: "sre-team"}, ActionApply, "infra/prod")
+	assert.True(t, ok)
+}
+
+func TestUserAuthorizer_EmptyConfigAllowsEverything(t *testing.T) {
+	a := NewUserAuthorizer(UserAuthorizerConfig{})
+	ok, _ := a.IsAuthorized("owner/repo", models.User{Username: "anyone"}, ActionApply, "infra/prod")
+	assert.True(t, ok)
+}
+
+// fakeTeamResolver resolves team membership from a fixed map, standing in
+// for a real GitHub/GitLab teams API client.
+type fakeTeamResolver map[string][]string
+
+func (f fakeTeamResolver) Teams(repoFullName string, user models.User) ([]string, error) {
+	return f[user.Username], nil
+}
+
+func TestUserAuthorizer_AllowlistMatchesTeamMembership(t *testing.T) {
+	a := NewUserAuthorizer(UserAuthorizerConfig{
+		Allowlist: map[Action][]string{
+			ActionApply: {"sre-team"},
+		},
+		Teams: fakeTeamResolver{"alice": {"sre-team"}},
+	})
+
+	ok, _ := a.IsAuthorized("owner/repo", models.User{Username: "alice"}, ActionApply, "")
+	assert.True(t, ok, "alice is a member of the allow-listed sre-team, even though her username isn't on the list")
+
+	ok, reason := a.IsAuthorized("owner/repo", models.User{Username: "bob"}, ActionApply, "")
+	assert.False(t, ok, "bob belongs to no team on the allowlist")
+	assert.Contains(t, reason, "not allowed to run")
+}
+
+func TestUserAuthorizer_DirectoryOwnersMatchesTeamMembership(t *testing.T) {
+	a := NewUserAuthorizer(UserAuthorizerConfig{
+		DirectoryOwners: map[string][]string{
+			"infra/prod": {"sre-team"},
+		},
+		Teams: fakeTeamResolver{"alice": {"sre-team"}},
+	})
+
+	ok, _ := a.IsAuthorized("owner/repo", models.User{Username: "alice"}, ActionApply, "infra/prod")
+	assert.True(t, ok)
+
+	ok, _ = a.IsAuthorized("owner/repo", models.User{Username: "bob"}, ActionApply, "infra/prod")
+	assert.False(t, ok)
+}
+
+func TestUserAuthorizer_NilTeamsNeverMatchesTeamNames(t *testing.T) {
+	a := NewUserAuthorizer(UserAuthorizerConfig{
+		Allowlist: map[Action][]string{
+			ActionApply: {"sre-team"},
+		},
+	})
+
+	ok, _ := a.IsAuthorized("owner/repo", models.User{Username: "sre-team"}, ActionApply, "")
+	assert.True(t, ok, "a username that happens to equal the team name still matches the literal list entry")
+
+	ok, _ = a.IsAuthorized("owner/repo", models.User{Username: "alice"}, ActionApply, "")
+	assert.False(t, ok, "without a Teams resolver there's no way to know alice is on sre-team")
+}
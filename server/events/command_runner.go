@@ -15,6 +15,9 @@ package events
 
 import (
 	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	log "gopkg.in/inconshreveable/log15.v2"
 
@@ -70,9 +73,35 @@ type DefaultCommandRunner struct {
 	AllowForkPRsFlag      string
 	ProjectCommandBuilder ProjectCommandBuilder
 	ProjectCommandRunner  ProjectCommandRunner
+	// Authorizer gates who may run plan/apply and, per-directory, who may
+	// apply. A nil Authorizer allows everything, preserving the pre-ACL
+	// behaviour where AllowForkPRs and repo membership were the only gates.
+	Authorizer Authorizer
+	// Jobs enqueues the actual plan/apply work onto a worker pool so
+	// RunCommentCommand and RunAutoplanCommand can return to the webhook
+	// handler immediately instead of blocking on Terraform.
+	Jobs *JobQueue
 }
 
 func (c *DefaultCommandRunner) RunAutoplanCommand(logger log.Logger, baseRepo models.Repo, headRepo models.Repo, pull models.PullRequest, user models.User) {
+	job := newCommandJob(baseRepo.FullName, pull.Num, Plan)
+	run := func() {
+		c.execAutoplanCommand(logger, baseRepo, headRepo, pull, user, job)
+	}
+
+	// Jobs is nil when the server wasn't configured with a queue (or in
+	// tests that construct a bare DefaultCommandRunner); fall back to
+	// running inline rather than panicking.
+	if c.Jobs == nil {
+		run()
+		return
+	}
+	if err := c.Jobs.Enqueue(job, run); err != nil {
+		logger.Error("unable to enqueue autoplan job", "err", err)
+	}
+}
+
+func (c *DefaultCommandRunner) execAutoplanCommand(logger log.Logger, baseRepo models.Repo, headRepo models.Repo, pull models.PullRequest, user models.User, job *CommandJob) {
 	pullLogger := c.buildLogger(logger, baseRepo.FullName, pull.Num)
 	ctx := &CommandContext{
 		User:     user,
@@ -81,8 +110,17 @@ func (c *DefaultCommandRunner) RunAutoplanCommand(logger log.Logger, baseRepo mo
 		HeadRepo: headRepo,
 		BaseRepo: baseRepo,
 	}
-	defer c.logPanics(ctx)
-	if !c.validateCtxAndComment(ctx) {
+	// Deferred in this order so that, on panic, logPanics (which records the
+	// panic into job.Result) runs before close(stopFlush) stops the live
+	// log flush, which in turn runs before finishJob computes the job's
+	// final status from job.Result.
+	defer c.finishJob(job, pullLogger)
+	stopFlush := c.startJob(job, pullLogger)
+	defer close(stopFlush)
+	defer c.logPanics(ctx, job)
+
+	if ok, reason := c.validateCtxAndComment(ctx, AutoplanCommand{}); !ok {
+		job.Result = CommandResult{Failure: reason}
 		return
 	}
 	if err := c.CommitStatusUpdater.Update(ctx.BaseRepo, ctx.Pull, vcs.Pending, Plan); err != nil {
@@ -91,7 +129,8 @@ func (c *DefaultCommandRunner) RunAutoplanCommand(logger log.Logger, baseRepo mo
 
 	projectCmds, err := c.ProjectCommandBuilder.BuildAutoplanCommands(ctx)
 	if err != nil {
-		c.updatePull(ctx, AutoplanCommand{}, CommandResult{Error: err})
+		job.Result = CommandResult{Error: err}
+		c.updatePull(ctx, AutoplanCommand{}, job.Result)
 		return
 	}
 
@@ -104,16 +143,39 @@ func (c *DefaultCommandRunner) RunAutoplanCommand(logger log.Logger, baseRepo mo
 			Workspace:            cmd.Workspace,
 		})
 	}
-	c.updatePull(ctx, AutoplanCommand{}, CommandResult{ProjectResults: results})
+	job.Result = CommandResult{ProjectResults: results}
+	c.updatePull(ctx, AutoplanCommand{}, job.Result)
 }
 
-// RunCommentCommand executes the command.
-// We take in a pointer for maybeHeadRepo because for some events there isn't
+// RunCommentCommand enqueues cmd for execution and returns immediately. We
+// take in a pointer for maybeHeadRepo because for some events there isn't
 // enough data to construct the Repo model and callers might want to wait until
 // the event is further validated before making an additional (potentially
 // wasteful) call to get the necessary data.
 func (c *DefaultCommandRunner) RunCommentCommand(logger log.Logger, baseRepo models.Repo, maybeHeadRepo *models.Repo, user models.User, pullNum int, cmd *CommentCommand) {
+	job := newCommandJob(baseRepo.FullName, pullNum, cmd.CommandName())
+	run := func() {
+		c.execCommentCommand(logger, baseRepo, maybeHeadRepo, user, pullNum, cmd, job)
+	}
+
+	// Jobs is nil when the server wasn't configured with a queue (or in
+	// tests that construct a bare DefaultCommandRunner); fall back to
+	// running inline rather than panicking.
+	if c.Jobs == nil {
+		run()
+		return
+	}
+	if err := c.Jobs.Enqueue(job, run); err != nil {
+		logger.Error("unable to enqueue command job", "err", err)
+	}
+}
+
+func (c *DefaultCommandRunner) execCommentCommand(logger log.Logger, baseRepo models.Repo, maybeHeadRepo *models.Repo, user models.User, pullNum int, cmd *CommentCommand, job *CommandJob) {
 	pullLogger := c.buildLogger(logger, baseRepo.FullName, pullNum)
+	stopFlush := c.startJob(job, pullLogger)
+	defer c.finishJob(job, pullLogger)
+	defer close(stopFlush)
+
 	var headRepo models.Repo
 	if maybeHeadRepo != nil {
 		headRepo = *maybeHeadRepo
@@ -131,6 +193,7 @@ func (c *DefaultCommandRunner) RunCommentCommand(logger log.Logger, baseRepo mod
 	}
 	if err != nil {
 		pullLogger.Error(err.Error())
+		job.Result = CommandResult{Error: err}
 		return
 	}
 	ctx := &CommandContext{
@@ -140,9 +203,12 @@ func (c *DefaultCommandRunner) RunCommentCommand(logger log.Logger, baseRepo mod
 		HeadRepo: headRepo,
 		BaseRepo: baseRepo,
 	}
-	defer c.logPanics(ctx)
+	// See execAutoplanCommand for why logPanics is deferred after (and so
+	// runs before) close(stopFlush)/finishJob.
+	defer c.logPanics(ctx, job)
 
-	if !c.validateCtxAndComment(ctx) {
+	if ok, reason := c.validateCtxAndComment(ctx, cmd); !ok {
+		job.Result = CommandResult{Failure: reason}
 		return
 	}
 
@@ -155,31 +221,39 @@ func (c *DefaultCommandRunner) RunCommentCommand(logger log.Logger, baseRepo mod
 	case Plan:
 		projectCmd, err := c.ProjectCommandBuilder.BuildPlanCommand(ctx, cmd)
 		if err != nil {
-			c.updatePull(ctx, cmd, CommandResult{Error: err})
+			job.Result = CommandResult{Error: err}
+			c.updatePull(ctx, cmd, job.Result)
 			return
 		}
 		result = c.ProjectCommandRunner.Plan(projectCmd)
 	case Apply:
 		projectCmd, err := c.ProjectCommandBuilder.BuildApplyCommand(ctx, cmd)
 		if err != nil {
-			c.updatePull(ctx, cmd, CommandResult{Error: err})
+			job.Result = CommandResult{Error: err}
+			c.updatePull(ctx, cmd, job.Result)
 			return
 		}
+		if c.Authorizer != nil {
+			if ok, reason := c.Authorizer.IsAuthorized(ctx.BaseRepo.FullName, ctx.User, ActionApply, projectCmd.RepoRelDir); !ok {
+				ctx.Logger.Info("apply rejected by authorizer", "user", ctx.User.Username, "dir", projectCmd.RepoRelDir, "reason", reason)
+				job.Result = CommandResult{Error: errors.Errorf("apply rejected: %s", reason)}
+				c.updatePull(ctx, cmd, job.Result)
+				return
+			}
+		}
 		result = c.ProjectCommandRunner.Apply(projectCmd)
 	default:
 		ctx.Logger.Error("failed to determine desired command, neither plan nor apply")
 		return
 	}
 
-	c.updatePull(
-		ctx,
-		cmd,
-		CommandResult{
-			ProjectResults: []ProjectResult{{
-				RepoRelDir:           cmd.RepoRelDir,
-				Workspace:            cmd.Workspace,
-				ProjectCommandResult: result,
-			}}})
+	job.Result = CommandResult{
+		ProjectResults: []ProjectResult{{
+			RepoRelDir:           cmd.RepoRelDir,
+			Workspace:            cmd.Workspace,
+			ProjectCommandResult: result,
+		}}}
+	c.updatePull(ctx, cmd, job.Result)
 }
 
 func (c *DefaultCommandRunner) getGithubData(baseRepo models.Repo, pullNum int) (models.PullRequest, models.Repo, error) {
@@ -216,19 +290,46 @@ func (c *DefaultCommandRunner) buildLogger(parentLogger log.Logger, repoFullName
 	return pullLogger
 }
 
-func (c *DefaultCommandRunner) validateCtxAndComment(ctx *CommandContext) bool {
+// validateCtxAndComment returns whether ctx is allowed to proceed. When it
+// isn't, reason explains why (and has already been posted to the pull
+// request as a comment); callers use it to record why the command's job
+// didn't run rather than letting it default to looking like a success.
+func (c *DefaultCommandRunner) validateCtxAndComment(ctx *CommandContext, cmd CommandInterface) (bool, string) {
 	if !c.AllowForkPRs && ctx.HeadRepo.Owner != ctx.BaseRepo.Owner {
 		ctx.Logger.Info("command was run on a fork pull request which is disallowed")
-		c.VCSClient.CreateComment(ctx.BaseRepo, ctx.Pull.Num, fmt.Sprintf("Atlantis commands can't be run on fork pull requests. To enable, set --%s", c.AllowForkPRsFlag)) // nolint: errcheck
-		return false
+		reason := fmt.Sprintf("can't be run on fork pull requests. To enable, set --%s", c.AllowForkPRsFlag)
+		c.VCSClient.CreateComment(ctx.BaseRepo, ctx.Pull.Num, "Atlantis commands "+reason) // nolint: errcheck
+		return false, reason
 	}
 
 	if ctx.Pull.State != models.Open {
 		ctx.Logger.Info("command was run on closed pull request")
-		c.VCSClient.CreateComment(ctx.BaseRepo, ctx.Pull.Num, "Atlantis commands can't be run on closed pull requests") // nolint: errcheck
-		return false
+		reason := "can't be run on closed pull requests"
+		c.VCSClient.CreateComment(ctx.BaseRepo, ctx.Pull.Num, "Atlantis commands "+reason) // nolint: errcheck
+		return false, reason
 	}
-	return true
+
+	// Autoplan isn't a user-initiated command, so there's no user action to
+	// authorize.
+	if c.Authorizer != nil && !cmd.IsAutoplan() {
+		action := actionForCommandName(cmd.CommandName())
+		if ok, reason := c.Authorizer.IsAuthorized(ctx.BaseRepo.FullName, ctx.User, action, ""); !ok {
+			ctx.Logger.Info("command rejected by authorizer", "user", ctx.User.Username, "reason", reason)
+			c.VCSClient.CreateComment(ctx.BaseRepo, ctx.Pull.Num, fmt.Sprintf("Atlantis command rejected: %s", reason)) // nolint: errcheck
+			return false, reason
+		}
+	}
+
+	return true, ""
+}
+
+// actionForCommandName maps a CommandName to the Action an Authorizer
+// understands. It's only called for user-initiated commands (not autoplan).
+func actionForCommandName(name CommandName) Action {
+	if name == Apply {
+		return ActionApply
+	}
+	return ActionPlan
 }
 
 func (c *DefaultCommandRunner) updatePull(ctx *CommandContext, command CommandInterface, res CommandResult) {
@@ -252,12 +353,105 @@ func (c *DefaultCommandRunner) updatePull(ctx *CommandContext, command CommandIn
 	}
 }
 
-// logPanics logs and creates a comment on the pull request for panics.
-func (c *DefaultCommandRunner) logPanics(ctx *CommandContext) {
+// logPanics logs and creates a comment on the pull request for panics. It
+// also records the panic into job.Result so finishJob (deferred before
+// this, and therefore running after it) marks the job as failed instead of
+// successful.
+func (c *DefaultCommandRunner) logPanics(ctx *CommandContext, job *CommandJob) {
 	if err := recover(); err != nil {
 		stack := recovery.Stack(3)
+		job.Result = CommandResult{Error: errors.Errorf("goroutine panic: %v", err)}
 		c.VCSClient.CreateComment(ctx.BaseRepo, ctx.Pull.Num, // nolint: errcheck
 			fmt.Sprintf("**Error: goroutine panic. This is a bug.**\n```\n%s\n%s```", err, stack))
 		ctx.Logger.Error(fmt.Sprintf("PANIC: %s", err), "stack", stack)
 	}
-}
\ No newline at end of file
+}
+
+var jobIDCounter uint64
+
+// jobIDReplacer makes a repo's full name ("owner/repo") safe to embed in a
+// job ID that's later used as a mux route variable and a URL path segment;
+// without it, ID's "/" would be indistinguishable from a path separator.
+var jobIDReplacer = strings.NewReplacer("/", "-")
+
+// newCommandJob creates a queued CommandJob. The worker that eventually runs
+// it fills in Result, LogTail, and the remaining timestamps.
+func newCommandJob(repoFullName string, pullNum int, command CommandName) *CommandJob {
+	id := atomic.AddUint64(&jobIDCounter, 1)
+	return &CommandJob{
+		ID:      fmt.Sprintf("%s-%d-%s-%d", jobIDReplacer.Replace(repoFullName), pullNum, command.String(), id),
+		Repo:    repoFullName,
+		PullNum: pullNum,
+		Command: command,
+		Status:  JobStatusQueued,
+	}
+}
+
+// logTailFlushInterval is how often a running job's LogTail is refreshed
+// from pullLogger so StreamJobLogs has something new to show between
+// startJob and finishJob.
+const logTailFlushInterval = 2 * time.Second
+
+// startJob marks job as running, persists it, and-when the runner is backed
+// by a JobStore-starts a goroutine that periodically flushes pullLogger's
+// buffered output into job.LogTail so StreamJobLogs can show progress while
+// the command is still executing. The caller must close the returned
+// channel once the job is done to stop that goroutine.
+func (c *DefaultCommandRunner) startJob(job *CommandJob, pullLogger log.Logger) chan struct{} {
+	stop := make(chan struct{})
+	job.Status = JobStatusRunning
+	job.StartedAt = time.Now()
+	if c.Jobs == nil {
+		return stop
+	}
+	if err := c.Jobs.Store.Save(job); err != nil {
+		pullLogger.Warn("unable to save job", "id", job.ID, "err", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(logTailFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				c.flushLogTail(job, pullLogger)
+			}
+		}
+	}()
+	return stop
+}
+
+// flushLogTail copies pullLogger's buffered output into job.LogTail and
+// persists it, without touching job.Status or job.Result.
+func (c *DefaultCommandRunner) flushLogTail(job *CommandJob, pullLogger log.Logger) {
+	logHistory, ok := pullLogger.GetHandler().(*logging.HistoryHandler)
+	if !ok {
+		return
+	}
+	job.LogTail = logHistory.History.String()
+	if err := c.Jobs.Store.Save(job); err != nil {
+		pullLogger.Warn("unable to save job", "id", job.ID, "err", err)
+	}
+}
+
+// finishJob records the outcome of job once its work is done, pulling the
+// rendered log output out of pullLogger's history handler.
+func (c *DefaultCommandRunner) finishJob(job *CommandJob, pullLogger log.Logger) {
+	job.FinishedAt = time.Now()
+	if job.Result.Error != nil || job.Result.Failure != "" {
+		job.Status = JobStatusFailure
+	} else {
+		job.Status = JobStatusSuccess
+	}
+	if logHistory, ok := pullLogger.GetHandler().(*logging.HistoryHandler); ok {
+		job.LogTail = logHistory.History.String()
+	}
+	if c.Jobs == nil {
+		return
+	}
+	if err := c.Jobs.Store.Save(job); err != nil {
+		pullLogger.Warn("unable to save job", "id", job.ID, "err", err)
+	}
+}
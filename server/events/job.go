@@ -0,0 +1,114 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// JobStatus is the lifecycle state of a CommandJob.
+type JobStatus string
+
+const (
+	JobStatusQueued  JobStatus = "queued"
+	JobStatusRunning JobStatus = "running"
+	JobStatusSuccess JobStatus = "success"
+	JobStatusFailure JobStatus = "failure"
+)
+
+// CommandJob is a persisted record of one RunCommentCommand or
+// RunAutoplanCommand invocation. It lets the webhook handler return
+// immediately after enqueuing the job instead of blocking on
+// `terraform plan`/`apply`, and gives operators a way to see what's
+// running and what happened afterwards, even across a restart.
+type CommandJob struct {
+	ID         string
+	Repo       string
+	PullNum    int
+	Command    CommandName
+	Status     JobStatus
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Result     CommandResult
+	LogTail    string
+}
+
+// JobStore persists CommandJobs so their status and output survive an
+// Atlantis restart and can be queried via the API and UI.
+type JobStore interface {
+	Save(job *CommandJob) error
+	Get(id string) (*CommandJob, error)
+	List() ([]CommandJob, error)
+}
+
+// jobJSON is CommandJob's on-disk/wire representation. CommandResult.Error
+// is a bare error interface: encoding/json marshals it as "{}" (silently
+// dropping the message) and refuses to unmarshal it at all, which would
+// make JobStore.Get/List fail for every job once any one of them had ever
+// errored. We persist that error as a plain string instead.
+type jobJSON struct {
+	ID         string
+	Repo       string
+	PullNum    int
+	Command    CommandName
+	Status     JobStatus
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Result     commandResultJSON
+	LogTail    string
+}
+
+type commandResultJSON struct {
+	Error          string
+	Failure        string
+	ProjectResults []ProjectResult
+}
+
+// MarshalJSON implements json.Marshaler so CommandResult.Error round-trips
+// as a string instead of the bare error interface.
+func (j CommandJob) MarshalJSON() ([]byte, error) {
+	var errMsg string
+	if j.Result.Error != nil {
+		errMsg = j.Result.Error.Error()
+	}
+	return json.Marshal(jobJSON{
+		ID:         j.ID,
+		Repo:       j.Repo,
+		PullNum:    j.PullNum,
+		Command:    j.Command,
+		Status:     j.Status,
+		StartedAt:  j.StartedAt,
+		FinishedAt: j.FinishedAt,
+		Result: commandResultJSON{
+			Error:          errMsg,
+			Failure:        j.Result.Failure,
+			ProjectResults: j.Result.ProjectResults,
+		},
+		LogTail: j.LogTail,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler, the inverse of MarshalJSON.
+func (j *CommandJob) UnmarshalJSON(data []byte) error {
+	var raw jobJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	j.ID = raw.ID
+	j.Repo = raw.Repo
+	j.PullNum = raw.PullNum
+	j.Command = raw.Command
+	j.Status = raw.Status
+	j.StartedAt = raw.StartedAt
+	j.FinishedAt = raw.FinishedAt
+	j.LogTail = raw.LogTail
+	j.Result = CommandResult{
+		Failure:        raw.Result.Failure,
+		ProjectResults: raw.Result.ProjectResults,
+	}
+	if raw.Result.Error != "" {
+		j.Result.Error = errors.New(raw.Result.Error)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// JobQueue runs CommandJobs on a worker pool so that webhook handlers never
+// block on a long-running `terraform plan`/`apply`. NewJobQueue's
+// globalPoolSize bounds how many jobs run concurrently across all repos;
+// its perRepoPoolSize additionally bounds concurrency within a single repo.
+// A worker that picks up a job whose repo is at its per-repo limit waits for
+// a slot in that repo and runs nothing else meanwhile, so a repo with many
+// queued jobs can occupy every worker while other repos' jobs wait.
+type JobQueue struct {
+	Store JobStore
+
+	tasks    chan *jobTask
+	repoSems map[string]chan struct{}
+	repoMu   sync.Mutex
+	repoCap  int
+}
+
+type jobTask struct {
+	job *CommandJob
+	run func()
+}
+
+// NewJobQueue constructs a JobQueue and starts globalPoolSize workers.
+// perRepoPoolSize <= 0 (an unset config value, or an operator leaving the
+// per-repo knob at its zero value) is treated as unlimited rather than
+// becoming an unbuffered semaphore that would deadlock the first job for
+// any repo.
+func NewJobQueue(store JobStore, globalPoolSize int, perRepoPoolSize int) *JobQueue {
+	if perRepoPoolSize <= 0 {
+		perRepoPoolSize = globalPoolSize
+	}
+	if perRepoPoolSize <= 0 {
+		perRepoPoolSize = 1
+	}
+	q := &JobQueue{
+		Store:    store,
+		tasks:    make(chan *jobTask, 1000),
+		repoSems: make(map[string]chan struct{}),
+		repoCap:  perRepoPoolSize,
+	}
+	for i := 0; i < globalPoolSize; i++ {
+		go q.work()
+	}
+	return q
+}
+
+func (q *JobQueue) work() {
+	for task := range q.tasks {
+		sem := q.repoSemaphore(task.job.Repo)
+		sem <- struct{}{}
+		task.run()
+		<-sem
+	}
+}
+
+func (q *JobQueue) repoSemaphore(repo string) chan struct{} {
+	q.repoMu.Lock()
+	defer q.repoMu.Unlock()
+	sem, ok := q.repoSems[repo]
+	if !ok {
+		sem = make(chan struct{}, q.repoCap)
+		q.repoSems[repo] = sem
+	}
+	return sem
+}
+
+// Enqueue persists job as queued and schedules run to execute it once a
+// worker slot is free for job's repo. It returns once the job is durably
+// queued, not once it's finished running.
+func (q *JobQueue) Enqueue(job *CommandJob, run func()) error {
+	job.Status = JobStatusQueued
+	if err := q.Store.Save(job); err != nil {
+		return errors.Wrap(err, "saving job")
+	}
+	q.tasks <- &jobTask{job: job, run: run}
+	return nil
+}
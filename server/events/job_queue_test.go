@@ -0,0 +1,125 @@
+package events
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeJobStore is a minimal in-memory JobStore for testing JobQueue and
+// DefaultCommandRunner without BoltDB.
+type fakeJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]CommandJob
+}
+
+func newFakeJobStore() *fakeJobStore {
+	return &fakeJobStore{jobs: make(map[string]CommandJob)}
+}
+
+func (s *fakeJobStore) Save(job *CommandJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = *job
+	return nil
+}
+
+func (s *fakeJobStore) Get(id string) (*CommandJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, nil
+	}
+	return &job, nil
+}
+
+func (s *fakeJobStore) List() ([]CommandJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []CommandJob
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func TestJobQueue_EnqueueRunsAndSavesJob(t *testing.T) {
+	store := newFakeJobStore()
+	q := NewJobQueue(store, 1, 1)
+
+	job := newCommandJob("owner/repo", 1, Plan)
+	var ran bool
+	done := make(chan struct{})
+	err := q.Enqueue(job, func() {
+		ran = true
+		close(done)
+	})
+	assert.NoError(t, err)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("job was never run")
+	}
+	assert.True(t, ran)
+
+	saved, err := store.Get(job.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, saved)
+}
+
+func TestJobQueue_PerRepoConcurrencyIsBounded(t *testing.T) {
+	store := newFakeJobStore()
+	q := NewJobQueue(store, 2, 1)
+
+	var mu sync.Mutex
+	running := 0
+	maxRunning := 0
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	run := func() {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		wg.Done()
+	}
+
+	assert.NoError(t, q.Enqueue(newCommandJob("owner/repo", 1, Plan), run))
+	assert.NoError(t, q.Enqueue(newCommandJob("owner/repo", 2, Plan), run))
+
+	wg.Wait()
+	assert.Equal(t, 1, maxRunning, "same-repo jobs should run one at a time given a per-repo pool size of 1")
+}
+
+func TestNewCommandJob_IDHasNoSlashes(t *testing.T) {
+	job := newCommandJob("owner/repo", 5, Plan)
+	assert.NotContains(t, job.ID, "/", "job IDs are used as mux route variables and URL path segments")
+}
+
+func TestJobQueue_ZeroPerRepoPoolSizeDoesNotDeadlock(t *testing.T) {
+	store := newFakeJobStore()
+	q := NewJobQueue(store, 2, 0)
+
+	done := make(chan struct{})
+	err := q.Enqueue(newCommandJob("owner/repo", 1, Plan), func() { close(done) })
+	assert.NoError(t, err)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("job never ran; a zero per-repo pool size must not produce an unbuffered (permanently blocking) semaphore")
+	}
+}
@@ -0,0 +1,36 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandJob_JSONRoundTripsError(t *testing.T) {
+	job := CommandJob{
+		ID:     "owner-repo-1-plan-1",
+		Status: JobStatusFailure,
+		Result: CommandResult{Error: errors.New("boom")},
+	}
+
+	serialized, err := json.Marshal(job)
+	assert.NoError(t, err)
+
+	var roundTripped CommandJob
+	assert.NoError(t, json.Unmarshal(serialized, &roundTripped))
+	assert.EqualError(t, roundTripped.Result.Error, "boom")
+	assert.Equal(t, JobStatusFailure, roundTripped.Status)
+}
+
+func TestCommandJob_JSONRoundTripsNilError(t *testing.T) {
+	job := CommandJob{ID: "owner-repo-1-plan-2", Status: JobStatusSuccess}
+
+	serialized, err := json.Marshal(job)
+	assert.NoError(t, err)
+
+	var roundTripped CommandJob
+	assert.NoError(t, json.Unmarshal(serialized, &roundTripped))
+	assert.Nil(t, roundTripped.Result.Error)
+}
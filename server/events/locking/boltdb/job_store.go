@@ -0,0 +1,79 @@
+package boltdb
+
+import (
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+	"github.com/runatlantis/atlantis/server/events"
+)
+
+// jobsBucketName is kept separate from the locks bucket so jobs and locks
+// can be reaped independently and so a corrupt jobs bucket can't take down
+// lock storage.
+const jobsBucketName = "jobs"
+
+// JobStore is a BoltDB-backed events.JobStore. It lives next to the lock
+// backend and, like it, opens its own bucket in the shared BoltDB file so
+// job state survives an Atlantis restart.
+type JobStore struct {
+	db *bolt.DB
+}
+
+// NewJobStore constructs a JobStore, creating the jobs bucket in db if it
+// doesn't already exist.
+func NewJobStore(db *bolt.DB) (*JobStore, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(jobsBucketName))
+		return errors.Wrap(err, "creating jobs bucket")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &JobStore{db: db}, nil
+}
+
+func (s *JobStore) Save(job *events.CommandJob) error {
+	serialized, err := json.Marshal(job)
+	if err != nil {
+		return errors.Wrap(err, "serializing job")
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(jobsBucketName))
+		return bucket.Put([]byte(job.ID), serialized)
+	})
+}
+
+func (s *JobStore) Get(id string) (*events.CommandJob, error) {
+	var job *events.CommandJob
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(jobsBucketName))
+		serialized := bucket.Get([]byte(id))
+		if serialized == nil {
+			return nil
+		}
+		var j events.CommandJob
+		if err := json.Unmarshal(serialized, &j); err != nil {
+			return errors.Wrapf(err, "deserializing job %q", id)
+		}
+		job = &j
+		return nil
+	})
+	return job, err
+}
+
+func (s *JobStore) List() ([]events.CommandJob, error) {
+	var jobs []events.CommandJob
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(jobsBucketName))
+		return bucket.ForEach(func(k, v []byte) error {
+			var job events.CommandJob
+			if err := json.Unmarshal(v, &job); err != nil {
+				return errors.Wrapf(err, "deserializing job %q", string(k))
+			}
+			jobs = append(jobs, job)
+			return nil
+		})
+	})
+	return jobs, err
+}
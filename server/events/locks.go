@@ -0,0 +1,33 @@
+package events
+
+import (
+	"github.com/pkg/errors"
+	"github.com/runatlantis/atlantis/server/events/models"
+)
+
+// UnlockAndCleanup deletes lock's workspace on disk, holding the working dir
+// lock for lock's repo, workspace and pull while it does so. It does not
+// release lock itself from the Locker; both callers do that beforehand
+// (LocksController.DeleteLock via Unlock, PullClosedExecutor via
+// UnlockByPull). It does not touch the VCS in any way (no comments);
+// callers are responsible for telling the user what happened. It's shared
+// by LocksController.DeleteLock (a single lock, one PR comment) and
+// PullClosedExecutor (many locks, one summary comment) so the workspace
+// cleanup can't drift between the two call sites.
+func UnlockAndCleanup(lock *models.ProjectLock, workingDir WorkingDir, workingDirLocker WorkingDirLocker) error {
+	// NOTE: Because BaseRepo was added to the PullRequest model later,
+	// previous installations of Atlantis will have locks in their DB that do
+	// not have this field on PullRequest. We skip deleting the working dir in
+	// this case.
+	if lock.Pull.BaseRepo == (models.Repo{}) {
+		return nil
+	}
+
+	unlock, err := workingDirLocker.TryLock(lock.Pull.BaseRepo.FullName, lock.Workspace, lock.Pull.Num)
+	if err != nil {
+		return errors.Wrap(err, "unable to obtain working dir lock when trying to delete old plans")
+	}
+	defer unlock()
+
+	return workingDir.DeleteForWorkspace(lock.Pull.BaseRepo, lock.Pull, lock.Workspace)
+}
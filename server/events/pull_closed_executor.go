@@ -0,0 +1,94 @@
+package events
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/runatlantis/atlantis/server/events/locking"
+	"github.com/runatlantis/atlantis/server/events/models"
+	"github.com/runatlantis/atlantis/server/events/vcs"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// PullClosedExecutor cleans up after a pull request is closed or merged:
+// it unlocks every project/workspace the pull held a lock on and deletes
+// their working directories, so locks don't pile up for PRs that were
+// merged without an explicit `atlantis unlock`.
+type PullClosedExecutor struct {
+	Locker           locking.Locker
+	VCSClient        vcs.ClientProxy
+	WorkingDir       WorkingDir
+	WorkingDirLocker WorkingDirLocker
+	Logger           log.Logger
+
+	mu        sync.Mutex
+	processed map[string]bool
+}
+
+// CleanUpPull unlocks and deletes the working directories for all locks
+// held by pull, then posts a single summary comment listing what was
+// discarded. It's safe to call more than once for the same pull (some VCSes
+// fire redundant closed/merged webhook events); the second call is a no-op.
+func (p *PullClosedExecutor) CleanUpPull(baseRepo models.Repo, pull models.PullRequest) error {
+	if p.alreadyProcessed(baseRepo.FullName, pull.Num) {
+		p.Logger.Debug("pull already processed, skipping lock cleanup", "pull", pull.Num)
+		return nil
+	}
+
+	locks, err := p.Locker.UnlockByPull(baseRepo.FullName, pull.Num)
+	if err != nil {
+		// Don't mark the pull processed: a VCS webhook redelivery of this
+		// same closed/merged event should retry cleanup rather than
+		// silently giving up and leaking these locks forever.
+		return errors.Wrap(err, "cleaning up locks")
+	}
+	// The locks are gone as of the UnlockByPull call above, so a retry from
+	// here on would find nothing left to unlock. Mark the pull processed
+	// now so a redelivered webhook event doesn't redo (harmless but
+	// wasteful) work, even if something below fails.
+	p.markProcessed(baseRepo.FullName, pull.Num)
+
+	if len(locks) == 0 {
+		return nil
+	}
+
+	for i := range locks {
+		lock := locks[i]
+		if err := UnlockAndCleanup(&lock, p.WorkingDir, p.WorkingDirLocker); err != nil {
+			p.Logger.Warn("unable to delete workspace for lock", "dir", lock.Project.Path, "workspace", lock.Workspace, "err", err)
+		}
+	}
+
+	return p.VCSClient.CreateComment(baseRepo, pull.Num, buildDiscardedPlansComment(locks))
+}
+
+// alreadyProcessed reports whether markProcessed has already been called
+// for this pull, without itself marking it. Kept read-only (as opposed to
+// the check-and-set pattern used previously) so CleanUpPull only marks a
+// pull processed once cleanup has actually made progress.
+func (p *PullClosedExecutor) alreadyProcessed(repoFullName string, pullNum int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.processed == nil {
+		return false
+	}
+	return p.processed[fmt.Sprintf("%s#%d", repoFullName, pullNum)]
+}
+
+func (p *PullClosedExecutor) markProcessed(repoFullName string, pullNum int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.processed == nil {
+		p.processed = make(map[string]bool)
+	}
+	p.processed[fmt.Sprintf("%s#%d", repoFullName, pullNum)] = true
+}
+
+func buildDiscardedPlansComment(locks []models.ProjectLock) string {
+	comment := "Locks and plans have been deleted for the projects and workspaces modified in this pull request:\n"
+	for _, lock := range locks {
+		comment += fmt.Sprintf("\n- dir: `%s` workspace: `%s`", lock.Project.Path, lock.Workspace)
+	}
+	return comment
+}
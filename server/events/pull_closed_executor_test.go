@@ -0,0 +1,30 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPullClosedExecutor_AlreadyProcessed(t *testing.T) {
+	p := &PullClosedExecutor{}
+
+	assert.False(t, p.alreadyProcessed("owner/repo", 1), "a pull isn't processed until markProcessed is called")
+	p.markProcessed("owner/repo", 1)
+	assert.True(t, p.alreadyProcessed("owner/repo", 1), "markProcessed should be reflected by a later check")
+
+	assert.False(t, p.alreadyProcessed("owner/repo", 2), "a different pull number isn't affected by #1's state")
+	assert.False(t, p.alreadyProcessed("owner/other-repo", 1), "a different repo isn't affected by owner/repo#1's state")
+}
+
+func TestPullClosedExecutor_AlreadyProcessedDoesNotMutate(t *testing.T) {
+	p := &PullClosedExecutor{}
+
+	assert.False(t, p.alreadyProcessed("owner/repo", 1))
+	assert.False(t, p.alreadyProcessed("owner/repo", 1), "checking alreadyProcessed must not itself mark the pull processed; only a successful UnlockByPull should")
+}
+
+func TestBuildDiscardedPlansComment(t *testing.T) {
+	comment := buildDiscardedPlansComment(nil)
+	assert.Contains(t, comment, "Locks and plans have been deleted")
+}
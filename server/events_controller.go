@@ -0,0 +1,26 @@
+package server
+
+import (
+	"github.com/runatlantis/atlantis/server/events"
+	"github.com/runatlantis/atlantis/server/events/models"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// EventsController is the entry point for VCS webhook events once they've
+// been parsed into Atlantis's models. It currently only handles pull
+// request close/merge so locks get cleaned up; comment and autoplan
+// dispatch happen earlier in the webhook pipeline via CommandRunner.
+type EventsController struct {
+	Logger             log.Logger
+	PullClosedExecutor *events.PullClosedExecutor
+}
+
+// HandlePullClosedEvent is called for GitHub "closed" and GitLab "merge"
+// pull request webhook events. It unlocks and cleans up the working
+// directories for every lock the pull held, then comments a summary back
+// on the pull request.
+func (e *EventsController) HandlePullClosedEvent(baseRepo models.Repo, pull models.PullRequest) {
+	if err := e.PullClosedExecutor.CleanUpPull(baseRepo, pull); err != nil {
+		e.Logger.Warn("unable to clean up locks for closed pull", "repo", baseRepo.FullName, "pull", pull.Num, "err", err)
+	}
+}
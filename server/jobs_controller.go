@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/runatlantis/atlantis/server/events"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// JobsController serves the job queue views: GET /jobs lists recent jobs,
+// GET /jobs/{id} returns one, and GET /jobs/{id}/logs streams its output as
+// it's produced. This is the audit trail for the async plan/apply queue.
+// GET /jobs and GET /jobs/{id} also serve JSON (send "Accept: application/json") so a CI
+// system or dashboard can poll job status without scraping HTML.
+type JobsController struct {
+	AtlantisVersion   string
+	JobStore          events.JobStore
+	Logger            log.Logger
+	JobIndexTemplate  TemplateWriter
+	JobDetailTemplate TemplateWriter
+}
+
+// ListJobs is the GET /jobs route.
+func (j *JobsController) ListJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := j.JobStore.List()
+	if err != nil {
+		j.respondErr(w, r, http.StatusInternalServerError, "listing jobs: %s", err)
+		return
+	}
+	if wantsJSON(r) {
+		j.respondJSON(w, http.StatusOK, jobs)
+		return
+	}
+	j.JobIndexTemplate.Execute(w, jobs) // nolint: errcheck
+}
+
+// GetJob is the GET /jobs/{id} route.
+func (j *JobsController) GetJob(w http.ResponseWriter, r *http.Request) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		j.respondErr(w, r, http.StatusBadRequest, "No job id in request")
+		return
+	}
+	job, err := j.JobStore.Get(id)
+	if err != nil {
+		j.respondErr(w, r, http.StatusInternalServerError, "getting job: %s", err)
+		return
+	}
+	if job == nil {
+		j.respondErr(w, r, http.StatusNotFound, "no job found at id %q", id)
+		return
+	}
+	if wantsJSON(r) {
+		j.respondJSON(w, http.StatusOK, job)
+		return
+	}
+	j.JobDetailTemplate.Execute(w, job) // nolint: errcheck
+}
+
+// StreamJobLogs is the GET /jobs/{id}/logs route. It streams the job's log
+// tail as server-sent events until the job finishes or the client
+// disconnects, so operators can watch a long `plan`/`apply` without
+// refreshing the page.
+func (j *JobsController) StreamJobLogs(w http.ResponseWriter, r *http.Request) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		j.respondErr(w, r, http.StatusBadRequest, "No job id in request")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		j.respondErr(w, r, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	var lastLog string
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			job, err := j.JobStore.Get(id)
+			if err != nil {
+				j.Logger.Warn("unable to read job for log stream", "id", id, "err", err)
+				return
+			}
+			if job == nil {
+				return
+			}
+			if job.LogTail != lastLog {
+				// Every line of an event's payload needs its own "data: " prefix.
+				chunk := strings.Replace(job.LogTail[len(lastLog):], "\n", "\ndata: ", -1)
+				fmt.Fprintf(w, "data: %s\n\n", chunk) // nolint: errcheck
+				flusher.Flush()
+				lastLog = job.LogTail
+			}
+			if job.Status == events.JobStatusSuccess || job.Status == events.JobStatusFailure {
+				return
+			}
+		}
+	}
+}
+
+// wantsJSON returns whether the caller asked for a JSON representation of
+// the job(s) instead of the HTML view.
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func (j *JobsController) respondJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		j.Logger.Error("unable to encode jobs response", "err", err)
+	}
+}
+
+func (j *JobsController) respondErr(w http.ResponseWriter, r *http.Request, code int, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	j.Logger.Warn(msg)
+	if wantsJSON(r) {
+		j.respondJSON(w, code, struct {
+			Error string `json:"error"`
+		}{Error: msg})
+		return
+	}
+	http.Error(w, msg, code)
+}
@@ -23,6 +23,15 @@ type LocksController struct {
 	LockDetailTemplate TemplateWriter
 	WorkingDir         events.WorkingDir
 	WorkingDirLocker   events.WorkingDirLocker
+	// Authorizer gates who may delete a lock. A nil Authorizer allows
+	// everyone to unlock, preserving the pre-ACL behaviour.
+	Authorizer events.Authorizer
+	// Auth must be set whenever Authorizer is: the locks UI has no session
+	// of its own, so the only way to trust the caller-supplied identity
+	// used for authorization is to require the same shared API token
+	// APIController does, proving the caller isn't just an anonymous
+	// browser passing whatever username it likes.
+	Auth *APITokenAuth
 }
 
 // GetLock is the GET /locks/{id} route. It renders the lock detail view.
@@ -77,6 +86,37 @@ func (l *LocksController) DeleteLock(w http.ResponseWriter, r *http.Request) {
 		l.respond(w, log.LvlWarn, http.StatusBadRequest, "Invalid lock id %q. Failed with error: %s", id, err)
 		return
 	}
+
+	if l.Authorizer != nil {
+		// The caller-supplied identity below is only trustworthy once we
+		// know the caller holds the shared API token; otherwise anyone
+		// could claim to be an allow-listed user via the request itself.
+		if l.Auth == nil || !l.Auth.authorized(r) {
+			l.respond(w, log.LvlWarn, http.StatusUnauthorized, "a valid API token is required to unlock when an Authorizer is configured")
+			return
+		}
+
+		existing, err := l.Locker.GetLock(idUnencoded)
+		if err != nil {
+			l.respond(w, log.LvlError, http.StatusInternalServerError, "getting lock failed with: %s", err)
+			return
+		}
+		if existing == nil {
+			l.respond(w, log.LvlInfo, http.StatusNotFound, "No lock found at id %q", idUnencoded)
+			return
+		}
+		requestedBy := requestingUser(r)
+		if ok, reason := l.Authorizer.IsAuthorized(existing.Project.RepoFullName, requestedBy, events.ActionUnlock, ""); !ok {
+			l.Logger.Info("unlock rejected by authorizer", "user", requestedBy.Username, "reason", reason)
+			if existing.Pull.BaseRepo != (models.Repo{}) {
+				comment := fmt.Sprintf("Unlock of dir: `%s` workspace: `%s` was rejected: %s", existing.Project.Path, existing.Workspace, reason)
+				l.VCSClient.CreateComment(existing.Pull.BaseRepo, existing.Pull.Num, comment) // nolint: errcheck
+			}
+			l.respond(w, log.LvlWarn, http.StatusForbidden, "unlock rejected: %s", reason)
+			return
+		}
+	}
+
 	lock, err := l.Locker.Unlock(idUnencoded)
 	if err != nil {
 		l.respond(w, log.LvlError, http.StatusInternalServerError, "deleting lock failed with: %s", err)
@@ -91,12 +131,7 @@ func (l *LocksController) DeleteLock(w http.ResponseWriter, r *http.Request) {
 	// installations of Atlantis will have locks in their DB that do not have
 	// this field on PullRequest. We skip commenting and deleting the working dir in this case.
 	if lock.Pull.BaseRepo != (models.Repo{}) {
-		unlock, err := l.WorkingDirLocker.TryLock(lock.Pull.BaseRepo.FullName, lock.Workspace, lock.Pull.Num)
-		if err != nil {
-			l.Logger.Error("unable to obtain working dir lock when trying to delete old plans", "err", err)
-		} else {
-			defer unlock()
-			err = l.WorkingDir.DeleteForWorkspace(lock.Pull.BaseRepo, lock.Pull, lock.Workspace)
+		if err := events.UnlockAndCleanup(lock, l.WorkingDir, l.WorkingDirLocker); err != nil {
 			l.Logger.Error("unable to delete workspace", "err", err)
 		}
 